@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"container/list"
+	"sync"
+)
+
+// blockCacheKey identifies one data block across every SSTable in the tree.
+type blockCacheKey struct {
+	sstableID int
+	offset    int64
+}
+
+type blockCacheEntry struct {
+	key  blockCacheKey
+	data []byte
+}
+
+// blockCache is a byte-budgeted LRU cache of decoded (post-decompression)
+// data blocks, keyed by (sstableID, blockOffset), so a hot block is read and
+// decompressed from disk at most once rather than on every Get. A nil
+// *blockCache or one built with capacityMiB 0 behaves as always-miss.
+type blockCache struct {
+	mu       sync.Mutex
+	capacity int64
+	size     int64
+	order    *list.List // front = least recently used
+	items    map[blockCacheKey]*list.Element
+
+	hits   uint64
+	misses uint64
+}
+
+func newBlockCache(capacityMiB int) *blockCache {
+	return &blockCache{
+		capacity: int64(capacityMiB) * 1024 * 1024,
+		order:    list.New(),
+		items:    make(map[blockCacheKey]*list.Element),
+	}
+}
+
+func (c *blockCache) get(key blockCacheKey) ([]byte, bool) {
+	if c == nil || c.capacity == 0 {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.order.MoveToBack(el)
+	return el.Value.(*blockCacheEntry).data, true
+}
+
+// put stores data under key and evicts the least-recently-used entries
+// until the cache is back within budget. It reports whether data was
+// retained, so callers managing a pooled buffer know whether ownership
+// passed to the cache or the buffer is still theirs to release.
+func (c *blockCache) put(key blockCacheKey, data []byte) bool {
+	if c == nil || c.capacity == 0 || int64(len(data)) > c.capacity {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.size += int64(len(data)) - int64(len(el.Value.(*blockCacheEntry).data))
+		el.Value.(*blockCacheEntry).data = data
+		c.order.MoveToBack(el)
+	} else {
+		el := c.order.PushBack(&blockCacheEntry{key: key, data: data})
+		c.items[key] = el
+		c.size += int64(len(data))
+	}
+
+	for c.size > c.capacity && c.order.Len() > 0 {
+		oldest := c.order.Front()
+		c.order.Remove(oldest)
+		entry := oldest.Value.(*blockCacheEntry)
+		delete(c.items, entry.key)
+		c.size -= int64(len(entry.data))
+	}
+	return true
+}
+
+// stats reports cumulative hit/miss counts, surfaced on GET /stats.
+func (c *blockCache) stats() (hits, misses uint64) {
+	if c == nil {
+		return 0, 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
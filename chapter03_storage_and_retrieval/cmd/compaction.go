@@ -0,0 +1,451 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	maxLSMLevels = 10 // levels[0..9], modeled after goleveldb's default depth
+
+	defaultL0CompactionTrigger = 4                // compact L0 once it holds this many files
+	defaultBaseLevelSize       = 10 * 1024 * 1024  // level 1 budget; level L budget is baseLevelSize * 10^(L-1)
+	maxCompactedSSTableSize    = 2 * 1024 * 1024   // target max size of a compaction output file
+	compactionPollInterval     = 500 * time.Millisecond
+)
+
+// nudgeCompaction wakes the compaction goroutine without blocking the caller.
+func (lsm *LSMTree) nudgeCompaction() {
+	select {
+	case lsm.compactionSig <- struct{}{}:
+	default:
+	}
+}
+
+// compactionLoop runs for the lifetime of the tree, checking whether any level
+// is over budget after every flush (or periodically, in case a check was missed).
+func (lsm *LSMTree) compactionLoop() {
+	ticker := time.NewTicker(compactionPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lsm.stopCompaction:
+			return
+		case <-lsm.compactionSig:
+			lsm.maybeCompact()
+		case <-ticker.C:
+			lsm.maybeCompact()
+		}
+	}
+}
+
+// maybeCompact compacts at most one over-budget level per call; the ticker and
+// post-flush nudges will pick up anything left over on the next pass.
+func (lsm *LSMTree) maybeCompact() {
+	level := lsm.pickCompactionLevel()
+	if level < 0 {
+		return
+	}
+	if err := lsm.compactLevel(level); err != nil {
+		fmt.Printf("Compaction of level %d failed: %v\n", level, err)
+	}
+}
+
+// pickCompactionLevel returns the lowest level that is over budget, or -1 if
+// every level is within its size target.
+func (lsm *LSMTree) pickCompactionLevel() int {
+	lsm.levelsMu.RLock()
+	defer lsm.levelsMu.RUnlock()
+
+	if len(lsm.levels[0]) >= lsm.l0CompactionTrigger {
+		return 0
+	}
+	for level := 1; level < len(lsm.levels)-1; level++ {
+		if lsm.levelBytesLocked(level) > lsm.levelBudget(level) {
+			return level
+		}
+	}
+	return -1
+}
+
+// levelBudget returns the target byte size for a level; level 0 has no byte
+// budget, it is compacted on file count alone.
+func (lsm *LSMTree) levelBudget(level int) int64 {
+	budget := lsm.baseLevelSize
+	for i := 1; i < level; i++ {
+		budget *= 10
+	}
+	return budget
+}
+
+func (lsm *LSMTree) levelBytesLocked(level int) int64 {
+	var total int64
+	for _, id := range lsm.levels[level] {
+		if sst := lsm.sstables[id]; sst != nil {
+			total += sst.size
+		}
+	}
+	return total
+}
+
+// compactLevel picks the oldest (L0) or largest (L1+) file at `level`, merges
+// it with every overlapping file at level+1, and installs the result at
+// level+1 in place of the inputs.
+func (lsm *LSMTree) compactLevel(level int) error {
+	source, overlaps := lsm.pickCompactionInputs(level)
+	if source == nil {
+		return nil
+	}
+
+	bottommost := level+1 == len(lsm.levels)-1
+	merged, err := lsm.mergeSSTables(source, overlaps, bottommost)
+	if err != nil {
+		return err
+	}
+
+	newTables, err := lsm.writeCompactedSSTables(merged, level+1)
+	if err != nil {
+		return err
+	}
+
+	lsm.installCompactionResult(level, source, overlaps, newTables)
+
+	for _, old := range append([]*SSTableReader{source}, overlaps...) {
+		if err := os.Remove(old.filename); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Warning: failed to remove compacted SSTable %s: %v\n", old.filename, err)
+		}
+	}
+	fmt.Printf("Compacted level %d file %s with %d level %d file(s) into %d new file(s)\n",
+		level, source.filename, len(overlaps), level+1, len(newTables))
+	return nil
+}
+
+// pickCompactionInputs chooses the source file at `level` (oldest for L0,
+// largest for L1+) and every file at level+1 whose key range overlaps it.
+func (lsm *LSMTree) pickCompactionInputs(level int) (*SSTableReader, []*SSTableReader) {
+	lsm.levelsMu.RLock()
+	defer lsm.levelsMu.RUnlock()
+
+	ids := lsm.levels[level]
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var source *SSTableReader
+	if level == 0 {
+		source = lsm.sstables[ids[0]] // oldest: levels[0] is append-ordered
+	} else {
+		for _, id := range ids {
+			sst := lsm.sstables[id]
+			if sst == nil {
+				continue
+			}
+			if source == nil || sst.size > source.size {
+				source = sst
+			}
+		}
+	}
+	if source == nil {
+		return nil, nil
+	}
+
+	var overlaps []*SSTableReader
+	for _, id := range lsm.levels[level+1] {
+		sst := lsm.sstables[id]
+		if sst == nil {
+			continue
+		}
+		if sst.maxKey < source.minKey || sst.minKey > source.maxKey {
+			continue
+		}
+		overlaps = append(overlaps, sst)
+	}
+	return source, overlaps
+}
+
+// mergeSSTables k-way merges source with its overlaps, keeping the newest
+// version (by Seq) of any duplicate key. For every live snapshot that
+// predates that newest version, the newest version at or before that
+// snapshot's own sequence is also retained, so each snapshot can still see
+// the value it pinned even though compaction has moved on - one retained
+// version per distinct live snapshot that needs one, not just the single
+// oldest. If bottommost is true, the destination level is the last one, so a
+// tombstone can be dropped entirely once no live snapshot predates it - at
+// that point nothing can still be shadowed by it.
+func (lsm *LSMTree) mergeSSTables(source *SSTableReader, overlaps []*SSTableReader, bottommost bool) ([]Entry, error) {
+	versions := make(map[string][]Entry)
+
+	collect := func(sst *SSTableReader) error {
+		entries, err := sst.ReadAll()
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			versions[e.Key] = append(versions[e.Key], e)
+		}
+		return nil
+	}
+	for _, sst := range overlaps {
+		if err := collect(sst); err != nil {
+			return nil, err
+		}
+	}
+	if err := collect(source); err != nil {
+		return nil, err
+	}
+
+	// Ascending; used to walk from the newest live snapshot down to the
+	// oldest, keeping only the versions some snapshot actually needs.
+	snapshotSeqs := lsm.liveSnapshotSeqs()
+	oldestPinned := uint64(math.MaxUint64)
+	if len(snapshotSeqs) > 0 {
+		oldestPinned = snapshotSeqs[0]
+	}
+
+	keys := make([]string, 0, len(versions))
+	for k := range versions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make([]Entry, 0, len(keys))
+	for _, k := range keys {
+		vs := versions[k]
+		sort.Slice(vs, func(i, j int) bool { return vs[i].Seq > vs[j].Seq })
+		newest := vs[0]
+
+		keep := []Entry{newest}
+		lastKept := newest.Seq
+		for i := len(snapshotSeqs) - 1; i >= 0; i-- {
+			snapSeq := snapshotSeqs[i]
+			if snapSeq >= lastKept {
+				// covered: a version already kept is visible to this
+				// snapshot too (Get's forward scan finds it first).
+				continue
+			}
+			for _, v := range vs {
+				if v.Seq <= snapSeq {
+					keep = append(keep, v)
+					lastKept = v.Seq
+					break
+				}
+			}
+		}
+		if bottommost && newest.Deleted && oldestPinned >= newest.Seq {
+			keep = keep[:0]
+		}
+		out = append(out, keep...)
+	}
+	return out, nil
+}
+
+// writeCompactedSSTables splits merged entries into one or more files tagged
+// with `level`. A file is closed once the estimated size of its entries
+// reaches maxCompactedSSTableSize (never inside a run of same-key versions),
+// so a file can run somewhat over that target. installCompactionResult, not
+// this function, adds the returned readers to the level manifest.
+func (lsm *LSMTree) writeCompactedSSTables(entries []Entry, level int) ([]*SSTableReader, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	if err := os.MkdirAll(lsm.sstablePrefix, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create sst directory: %w", err)
+	}
+
+	var (
+		out     []*SSTableReader
+		start   = 0
+		written int64
+	)
+	flush := func(end int) error {
+		// nextSSTableID is also read-then-incremented by flushMemTable, which
+		// runs under the server's request-handling mutex but this background
+		// compaction goroutine isn't, so it needs its own guard here.
+		lsm.levelsMu.Lock()
+		id := lsm.nextSSTableID
+		lsm.nextSSTableID++
+		lsm.levelsMu.Unlock()
+		filename := fmt.Sprintf("%s/%s-L%d-%04d.sst", lsm.sstablePrefix, lsm.sstablePrefix, level, id)
+		reader, err := writeSSTable(id, level, filename, entries[start:end], lsm.compression, lsm.blockCache)
+		if err != nil {
+			return err
+		}
+		out = append(out, reader)
+		return nil
+	}
+
+	for i, e := range entries {
+		written += int64(len(e.Key) + len(e.Value) + 2)
+		sameKeyFollows := i+1 < len(entries) && entries[i+1].Key == e.Key
+		if written >= maxCompactedSSTableSize && !sameKeyFollows {
+			if err := flush(i + 1); err != nil {
+				return nil, err
+			}
+			start = i + 1
+			written = 0
+		}
+	}
+	if start < len(entries) {
+		if err := flush(len(entries)); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// installCompactionResult swaps the level manifests to drop the compaction
+// inputs and add the new outputs. The write lock is held only for this swap;
+// the (potentially slow) merge and file writes above happen unlocked so
+// concurrent Gets are never blocked on compaction.
+func (lsm *LSMTree) installCompactionResult(level int, source *SSTableReader, overlaps []*SSTableReader, newTables []*SSTableReader) {
+	lsm.levelsMu.Lock()
+	defer lsm.levelsMu.Unlock()
+
+	lsm.levels[level] = removeID(lsm.levels[level], source.id)
+	delete(lsm.sstables, source.id)
+
+	next := lsm.levels[level+1]
+	overlapIDs := make(map[int]bool, len(overlaps))
+	for _, sst := range overlaps {
+		overlapIDs[sst.id] = true
+		delete(lsm.sstables, sst.id)
+	}
+	kept := next[:0]
+	for _, id := range next {
+		if !overlapIDs[id] {
+			kept = append(kept, id)
+		}
+	}
+	for _, sst := range newTables {
+		lsm.sstables[sst.id] = sst
+		kept = append(kept, sst.id)
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		return lsm.sstables[kept[i]].minKey < lsm.sstables[kept[j]].minKey
+	})
+	lsm.levels[level+1] = kept
+}
+
+func removeID(ids []int, target int) []int {
+	out := ids[:0]
+	for _, id := range ids {
+		if id != target {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// ForceCompact synchronously performs a full compaction: every file of every
+// level, from L0 down, is compacted into the level below it until all data
+// sits in the bottommost level. Used by the `lsm compact` subcommand and the
+// /compact endpoint; the background goroutine only compacts over-budget levels.
+func (lsm *LSMTree) ForceCompact() error {
+	for level := 0; level < len(lsm.levels)-1; level++ {
+		for {
+			lsm.levelsMu.RLock()
+			remaining := len(lsm.levels[level])
+			lsm.levelsMu.RUnlock()
+			if remaining == 0 {
+				break
+			}
+			if err := lsm.compactLevel(level); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LevelStats is the per-level summary reported by GET /stats.
+type LevelStats struct {
+	Level     int   `json:"level"`
+	FileCount int   `json:"file_count"`
+	Bytes     int64 `json:"bytes"`
+}
+
+func (lsm *LSMTree) Stats() []LevelStats {
+	lsm.levelsMu.RLock()
+	defer lsm.levelsMu.RUnlock()
+
+	stats := make([]LevelStats, len(lsm.levels))
+	for level, ids := range lsm.levels {
+		stats[level].Level = level
+		stats[level].FileCount = len(ids)
+		stats[level].Bytes = lsm.levelBytesLocked(level)
+	}
+	return stats
+}
+
+// BlockCacheStats reports the block cache's cumulative hit/miss counts.
+func (lsm *LSMTree) BlockCacheStats() (hits, misses uint64) {
+	return lsm.blockCache.stats()
+}
+
+func (s *LSMServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mutex.RLock()
+	stats := s.lsmTree.Stats()
+	hits, misses := s.lsmTree.BlockCacheStats()
+	s.mutex.RUnlock()
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"levels":             stats,
+		"block_cache_hits":   hits,
+		"block_cache_misses": misses,
+	})
+}
+
+func (s *LSMServer) handleCompact(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mutex.Lock()
+	err := s.lsmTree.ForceCompact()
+	s.mutex.Unlock()
+	if err != nil {
+		fmt.Printf("Compaction failed: %v\n", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+func makeHTTPCompactRequest(serverURL string) error {
+	resp, err := http.Post(serverURL+"/compact", "application/json", nil)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server error: %s", resp.Status)
+	}
+	return nil
+}
+
+func makeHTTPStatsRequest(serverURL string) ([]LevelStats, error) {
+	resp, err := http.Get(serverURL + "/stats")
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server error: %s", resp.Status)
+	}
+	var result struct {
+		Levels []LevelStats `json:"levels"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result.Levels, nil
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"sync"
+
+	"github.com/golang/snappy"
+)
+
+// Data block compression codecs. The tag is recorded in both the SSTable
+// footer (the file's nominal codec) and every block's own trailer (so a
+// block is self-describing even if that ever diverged).
+const (
+	compressionNone   byte = 0
+	compressionSnappy byte = 1
+)
+
+// parseCompression maps the --compression flag on `lsm serve` to the on-disk
+// tag written by writeSSTable.
+func parseCompression(name string) (byte, error) {
+	switch name {
+	case "", "none":
+		return compressionNone, nil
+	case "snappy":
+		return compressionSnappy, nil
+	default:
+		return 0, fmt.Errorf("unknown compression %q (want \"none\" or \"snappy\")", name)
+	}
+}
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// encodeBlock compresses raw if compression is non-none and appends the
+// trailer readBlock expects: [payload][1-byte compression tag][4-byte
+// big-endian CRC32C of payload].
+func encodeBlock(raw []byte, compression byte) []byte {
+	payload := raw
+	if compression == compressionSnappy {
+		payload = snappy.Encode(nil, raw)
+	}
+
+	out := make([]byte, 0, len(payload)+5)
+	out = append(out, payload...)
+	out = append(out, compression)
+	crcBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(crcBytes, crc32.Checksum(payload, castagnoliTable))
+	return append(out, crcBytes...)
+}
+
+// blockBufferPool recycles the destination buffer snappy.Decode writes into,
+// so steady-state Gets don't allocate a fresh buffer per block.
+var blockBufferPool = sync.Pool{
+	New: func() interface{} { return make([]byte, 0, sstableBlockSize*2) },
+}
+
+func releaseBlockBuffer(buf []byte) {
+	blockBufferPool.Put(buf[:0])
+}
+
+// decodeBlock validates a data block's trailer and decompresses it if
+// needed, trusting the block's own compression tag rather than the file's
+// nominal setting. pooled reports whether data came from blockBufferPool and
+// should be returned to it once the caller is done (readBlock does this
+// unless the block cache takes ownership instead).
+func decodeBlock(raw []byte) (data []byte, pooled bool, err error) {
+	if len(raw) < 5 {
+		return nil, false, fmt.Errorf("block too short to contain a trailer")
+	}
+	payload := raw[:len(raw)-5]
+	tag := raw[len(raw)-5]
+	wantCRC := binary.BigEndian.Uint32(raw[len(raw)-4:])
+	if crc32.Checksum(payload, castagnoliTable) != wantCRC {
+		return nil, false, fmt.Errorf("CRC32C mismatch")
+	}
+
+	if tag != compressionSnappy {
+		return payload, false, nil
+	}
+
+	// snappy.Decode branches on len(dst), not cap(dst), to decide whether it
+	// can reuse the buffer - reslice to the full capacity so a big-enough
+	// pooled buffer is actually reused instead of triggering a fresh alloc.
+	buf := blockBufferPool.Get().([]byte)
+	buf = buf[:cap(buf)]
+	decoded, err := snappy.Decode(buf, payload)
+	if err != nil {
+		blockBufferPool.Put(buf[:0])
+		return nil, false, fmt.Errorf("failed to decompress: %w", err)
+	}
+	if cap(decoded) != cap(buf) {
+		// payload didn't fit the pooled buffer, so Decode allocated its own;
+		// the pooled buffer was never touched, return it as-is.
+		blockBufferPool.Put(buf[:0])
+		return decoded, false, nil
+	}
+	return decoded, true, nil
+}
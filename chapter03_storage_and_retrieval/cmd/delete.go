@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Delete writes a tombstone for key through the same WAL+memtable path as
+// Set, so it gets the same durability and atomicity. Get treats a tombstone
+// as "not found" and stops searching older SSTables; compaction drops the
+// tombstone once it reaches the bottommost level, where no older value could
+// still be shadowed by it.
+func (lsm *LSMTree) Delete(key string) error {
+	batch := NewWriteBatch()
+	batch.Delete(key)
+	return lsm.Write(batch)
+}
+
+func (s *LSMServer) handleDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		fmt.Printf("DELETE request failed - Missing key parameter\n")
+		http.Error(w, "Missing key parameter", http.StatusBadRequest)
+		return
+	}
+
+	fmt.Printf("DELETE request: key=%s\n", key)
+	s.mutex.Lock()
+	err := s.lsmTree.Delete(key)
+	s.mutex.Unlock()
+	if err != nil {
+		fmt.Printf("DELETE failed: %v\n", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Printf("DELETE success: key=%s\n", key)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+func makeHTTPDeleteRequest(serverURL, key string) error {
+	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/key?key=%s", serverURL, key), nil)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server error: %s", resp.Status)
+	}
+	return nil
+}
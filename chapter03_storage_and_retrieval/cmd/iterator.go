@@ -0,0 +1,140 @@
+package cmd
+
+import "container/heap"
+
+// iterSource is one sorted run of entries (the memtable, or one SSTable's
+// ReadAll) being merged by an Iterator, plus a cursor into it.
+type iterSource struct {
+	entries []Entry
+	pos     int
+}
+
+// heapItem is the next not-yet-consumed entry of one source, ordered so that
+// the heap surfaces entries key-ascending and, within a key, newest-first.
+type heapItem struct {
+	entry  Entry
+	source *iterSource
+}
+
+type itemHeap []heapItem
+
+func (h itemHeap) Len() int { return len(h) }
+func (h itemHeap) Less(i, j int) bool {
+	if h[i].entry.Key != h[j].entry.Key {
+		return h[i].entry.Key < h[j].entry.Key
+	}
+	return h[i].entry.Seq > h[j].entry.Seq
+}
+func (h itemHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *itemHeap) Push(x interface{}) {
+	*h = append(*h, x.(heapItem))
+}
+func (h *itemHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// Iterator yields the newest version of each distinct key in [start, end)
+// visible to an optional snapshot, in ascending key order, skipping
+// tombstones. Returned by LSMTree.NewIterator.
+type Iterator struct {
+	heap     itemHeap
+	snap     *Snapshot
+	lastKey  string
+	haveLast bool
+	key      string
+	value    string
+	err      error
+}
+
+// NewIterator merges the memtable with every SSTable whose key range
+// overlaps [start, end) using a min-heap keyed by (key, -sequence), so the
+// newest visible version of each distinct key comes out of the heap first.
+// An empty start/end means unbounded on that side. Each SSTable is read via
+// ReadRange, which consults the block index built in chunk0-2 to fetch only
+// the blocks overlapping the range, rather than the whole file.
+func (lsm *LSMTree) NewIterator(start, end string, snap *Snapshot) *Iterator {
+	lsm.levelsMu.RLock()
+	levels := make([][]int, len(lsm.levels))
+	for i, ids := range lsm.levels {
+		levels[i] = append([]int(nil), ids...)
+	}
+	sstables := lsm.sstables
+	lsm.levelsMu.RUnlock()
+
+	it := &Iterator{snap: snap}
+	it.addSource(entriesInRange(lsm.memTable.entries, start, end))
+
+	for _, ids := range levels {
+		for _, id := range ids {
+			sst := sstables[id]
+			if sst == nil || sst.maxKey < start || (end != "" && sst.minKey >= end) {
+				continue
+			}
+			entries, err := sst.ReadRange(start, end)
+			if err != nil {
+				it.err = err
+				continue
+			}
+			it.addSource(entriesInRange(entries, start, end))
+		}
+	}
+	heap.Init(&it.heap)
+	return it
+}
+
+func entriesInRange(entries []Entry, start, end string) []Entry {
+	var out []Entry
+	for _, e := range entries {
+		if e.Key < start {
+			continue
+		}
+		if end != "" && e.Key >= end {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+func (it *Iterator) addSource(entries []Entry) {
+	if len(entries) == 0 {
+		return
+	}
+	heap.Push(&it.heap, heapItem{entry: entries[0], source: &iterSource{entries: entries}})
+}
+
+// Next advances the iterator and reports whether Key/Value now hold a row.
+// Stale or snapshot-invisible versions and tombstones are skipped
+// internally, so a single call may pop several heap entries before
+// surfacing one, or none at all if the range is exhausted.
+func (it *Iterator) Next() bool {
+	for it.heap.Len() > 0 {
+		top := heap.Pop(&it.heap).(heapItem)
+		if top.source.pos++; top.source.pos < len(top.source.entries) {
+			heap.Push(&it.heap, heapItem{entry: top.source.entries[top.source.pos], source: top.source})
+		}
+
+		e := top.entry
+		if it.haveLast && e.Key == it.lastKey {
+			continue // an older version of a key already decided this pass
+		}
+		if it.snap != nil && e.Seq > it.snap.seq {
+			continue // not visible yet; an older, visible version may follow
+		}
+		it.lastKey, it.haveLast = e.Key, true
+		if e.Deleted {
+			continue // tombstone: deleted as of snap, nothing to surface
+		}
+		it.key, it.value = e.Key, e.Value
+		return true
+	}
+	return false
+}
+
+func (it *Iterator) Key() string   { return it.key }
+func (it *Iterator) Value() string { return it.value }
+func (it *Iterator) Err() error    { return it.err }
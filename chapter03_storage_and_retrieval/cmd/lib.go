@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -62,13 +63,20 @@ type LSMServer struct {
 	mutex   sync.RWMutex // For thread safety
 }
 
-func startLSMServer(port, sstablePrefix string) {
+func startLSMServer(port, sstablePrefix string, maxMemTableSize int, compression byte, blockCacheMiB int) {
 	server := &LSMServer{
-		lsmTree: NewLSMTree(1000, sstablePrefix),
+		lsmTree: NewLSMTree(maxMemTableSize, sstablePrefix, compression, blockCacheMiB),
 	}
 
 	http.HandleFunc("/set", server.handleSet)
 	http.HandleFunc("/get", server.handleGet)
+	http.HandleFunc("/stats", server.handleStats)
+	http.HandleFunc("/compact", server.handleCompact)
+	http.HandleFunc("/batch", server.handleBatch)
+	http.HandleFunc("/key", server.handleDelete)
+	http.HandleFunc("/scan", server.handleScan)
+	http.HandleFunc("/snapshot", server.handleSnapshot)
+	http.HandleFunc("/snapshot/", server.handleSnapshotByID)
 
 	fmt.Printf("LSM Server listening on port: %s\n", port)
 	http.ListenAndServe(":"+port, nil)
@@ -132,9 +140,25 @@ func (s *LSMServer) handleGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var snap *Snapshot
+	if snapID := r.URL.Query().Get("snapshot"); snapID != "" {
+		id, err := strconv.ParseUint(snapID, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid snapshot parameter", http.StatusBadRequest)
+			return
+		}
+		s.mutex.RLock()
+		snap = s.lsmTree.lookupSnapshot(id)
+		s.mutex.RUnlock()
+		if snap == nil {
+			http.Error(w, "Unknown snapshot id", http.StatusNotFound)
+			return
+		}
+	}
+
 	fmt.Printf("GET request: key=%s\n", key)
 	s.mutex.RLock()
-	value, exists := s.lsmTree.Get(key)
+	value, exists := s.lsmTree.Get(key, snap)
 	s.mutex.RUnlock()
 
 	if !exists {
@@ -194,8 +218,10 @@ func makeHTTPGetRequest(serverURL, key string) (string, error) {
 
 // Sorted Entry for Memtable
 type Entry struct {
-	Key   string
-	Value string
+	Key     string
+	Value   string
+	Deleted bool   // tombstone: Value is meaningless when true
+	Seq     uint64 // write sequence; higher is newer, used for snapshot visibility
 }
 
 // sorted memtable (slice kept sorted by key)
@@ -204,59 +230,79 @@ type SortedMemTable struct {
 	size    int
 }
 
-// SS Table represents an immutable, sorted table
-type SSTable struct {
-	id      int     // unique identifier
-	entries []Entry // sorted entries
-	level   int     // which level this sstable belongs to
-}
-
 // true LSM-Tree structure
 type LSMTree struct {
 	memTable        *SortedMemTable
-	sstables        map[int]*SSTable // Map of SSTable ID -> SSTable
+	sstables        map[int]*SSTableReader // Map of SSTable ID -> reader (block index + bloom filter)
 	nextSSTableID   int
 	maxMemTableSize int
-	levels          [][]int // levels[i] = slice of SSTable IDs at level i
+	levels          [][]int // levels[i] = slice of SSTable IDs at level i; level 0 oldest first, levels 1+ sorted by minKey
+	levelsMu        sync.RWMutex
 	sstablePrefix   string
 	walPath         string
+
+	baseLevelSize       int64 // target byte size of level 1; level L budget is baseLevelSize * 10^(L-1)
+	l0CompactionTrigger int   // compact L0 once it holds this many files
+	compactionSig       chan struct{}
+	stopCompaction      chan struct{}
+
+	nextWALSeq uint64 // sequence number stamped on the next WriteBatch appended to the WAL
+
+	nextSeq        uint64 // next write sequence to stamp on a memtable/SSTable entry
+	snapshotsMu    sync.Mutex
+	snapshots      map[uint64]*Snapshot // live snapshots keyed by their own id
+	nextSnapshotID uint64
+
+	compression byte        // data block codec for newly written SSTables
+	blockCache  *blockCache // shared LRU of decoded data blocks across every SSTable
 }
 
-func NewLSMTree(maxMemTableSize int, sstablePrefix string) *LSMTree {
+func NewLSMTree(maxMemTableSize int, sstablePrefix string, compression byte, blockCacheMiB int) *LSMTree {
 	walPath := fmt.Sprintf("%s/wal.log", sstablePrefix)
 	lsm := &LSMTree{
 		memTable: &SortedMemTable{
 			entries: make([]Entry, 0),
 			size:    0,
 		},
-		sstables:        make(map[int]*SSTable),
+		sstables:        make(map[int]*SSTableReader),
 		nextSSTableID:   1,
 		maxMemTableSize: maxMemTableSize,
-		levels:          make([][]int, 10), // Support up to 10 levels
+		levels:          make([][]int, maxLSMLevels), // Support up to maxLSMLevels levels
 		sstablePrefix:   sstablePrefix,
 		walPath:         walPath, // WAL is stored in the same directory
+
+		baseLevelSize:       defaultBaseLevelSize,
+		l0CompactionTrigger: defaultL0CompactionTrigger,
+		compactionSig:       make(chan struct{}, 1),
+		stopCompaction:      make(chan struct{}),
+
+		nextSeq:        1,
+		snapshots:      make(map[uint64]*Snapshot),
+		nextSnapshotID: 1,
+
+		compression: compression,
+		blockCache:  newBlockCache(blockCacheMiB),
 	}
 	// replay WAL on startup to recover memtable
 	lsm.replayWAL()
+	// background compaction runs for the lifetime of the tree
+	go lsm.compactionLoop()
 	return lsm
 }
 
-func (lsm *LSMTree) writeToWAL(key, value string) error {
-	file, err := os.OpenFile(lsm.walPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to open WAL: %w", err)
-	}
-	defer file.Close()
+// Helper: Insert into sorted memtable
+func (mt *SortedMemTable) insert(key, value string, seq uint64) {
+	mt.put(key, value, false, seq)
+}
 
-	_, err = fmt.Fprintf(file, "%s,%s\n", key, value)
-	if err != nil {
-		return fmt.Errorf("failed to write to WAL: %w", err)
-	}
-	return nil
+// putTombstone marks key as deleted. Get must treat this as "not found" and
+// stop searching older SSTables; compaction drops the tombstone once it
+// reaches the bottommost level.
+func (mt *SortedMemTable) putTombstone(key string, seq uint64) {
+	mt.put(key, "", true, seq)
 }
 
-// Helper: Insert into sorted memtable
-func (mt *SortedMemTable) insert(key, value string) {
+func (mt *SortedMemTable) put(key, value string, deleted bool, seq uint64) {
 	// Binary search for insertion point
 	left, right := 0, len(mt.entries)
 	for left < right {
@@ -270,15 +316,22 @@ func (mt *SortedMemTable) insert(key, value string) {
 	// Check if key already exists
 	if left < len(mt.entries) && mt.entries[left].Key == key {
 		mt.entries[left].Value = value // Update existing
+		mt.entries[left].Deleted = deleted
+		mt.entries[left].Seq = seq
 	} else {
 		// Insert new entry
-		entry := Entry{Key: key, Value: value}
+		entry := Entry{Key: key, Value: value, Deleted: deleted, Seq: seq}
 		mt.entries = append(mt.entries[:left], append([]Entry{entry}, mt.entries[left:]...)...)
 		mt.size++
 	}
 }
 
-func (mt *SortedMemTable) get(key string) (string, bool) {
+// get reports whether key is present in the memtable. The memtable only ever
+// holds the latest version of a key (an overwrite replaces it in place), so a
+// hit whose Seq postdates a snapshot has no older in-memory version to fall
+// back to; callers fall through to the SSTables in that case, which is
+// correct as long as the prior version was already flushed.
+func (mt *SortedMemTable) get(key string) (Entry, bool) {
 	// Binary search
 	left, right := 0, len(mt.entries)
 	for left < right {
@@ -291,9 +344,9 @@ func (mt *SortedMemTable) get(key string) (string, bool) {
 	}
 
 	if left < len(mt.entries) && mt.entries[left].Key == key {
-		return mt.entries[left].Value, true
+		return mt.entries[left], true
 	}
-	return "", false
+	return Entry{}, false
 }
 
 func (lsm *LSMTree) flushMemTable() error {
@@ -305,135 +358,108 @@ func (lsm *LSMTree) flushMemTable() error {
 	if err := os.MkdirAll(lsm.sstablePrefix, 0755); err != nil {
 		return fmt.Errorf("failed to create sst directory: %w", err)
 	}
-	// use prefix for filename
-	filename := fmt.Sprintf("%s/%s-%04d.sst", lsm.sstablePrefix, lsm.sstablePrefix, lsm.nextSSTableID)
+	// nextSSTableID is also read-then-incremented by the background
+	// compaction goroutine (writeCompactedSSTables), which isn't covered by
+	// the server's request-handling mutex, so it needs its own guard here.
+	lsm.levelsMu.Lock()
+	id := lsm.nextSSTableID
+	lsm.nextSSTableID++
+	lsm.levelsMu.Unlock()
+	// use prefix for filename, tagging the level so file listings are easy to reason about
+	filename := fmt.Sprintf("%s/%s-L0-%04d.sst", lsm.sstablePrefix, lsm.sstablePrefix, id)
 
-	file, err := os.Create(filename)
+	reader, err := writeSSTable(id, 0, filename, lsm.memTable.entries, lsm.compression, lsm.blockCache)
 	if err != nil {
-		return fmt.Errorf("failed to create SSTable: %w", err)
+		return err
 	}
-	defer file.Close()
+	lsm.levelsMu.Lock()
+	lsm.sstables[id] = reader
+	lsm.levels[0] = append(lsm.levels[0], id)
+	lsm.levelsMu.Unlock()
 
-	// Write sorted entries to file
-	for _, entry := range lsm.memTable.entries {
-		_, err := fmt.Fprintf(file, "%s,%s\n", entry.Key, entry.Value)
-		if err != nil {
-			return fmt.Errorf("failed to write entry: %w", err)
-		}
-	}
 	fmt.Printf("Flushed memtable to file: %s\n", filename)
 	// clear memtable
 	lsm.memTable.entries = make([]Entry, 0)
 	lsm.memTable.size = 0
-	lsm.nextSSTableID++
 	// NOTE: Clear WAL after successful flush
 	if err := lsm.clearWAL(); err != nil {
 		fmt.Printf("Warning: failed to clear WAL: %v\n", err)
 		// NOTE: We do not return an error here, the flush was successful.
 	}
+	lsm.nudgeCompaction()
 	return nil
 }
 
-// LSM-Tree Set method with flushing
+// LSM-Tree Set method with flushing. Internally this is just a one-op batch,
+// so it gets the same WAL durability and atomicity as WriteBatch.
 func (lsm *LSMTree) Set(key, value string) error {
-	// Write to WAL first (durability)
-	if err := lsm.writeToWAL(key, value); err != nil {
-		return err
-	}
-	// Insert into memtable
-	lsm.memTable.insert(key, value)
-	// Check if we need to flush
-	if lsm.memTable.size >= lsm.maxMemTableSize {
-		err := lsm.flushMemTable()
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	batch := NewWriteBatch()
+	batch.Put(key, value)
+	return lsm.Write(batch)
 }
 
-// LSM-Tree Get method (checks memtable first, then SSTables)
-func (lsm *LSMTree) Get(key string) (string, bool) {
+// LSM-Tree Get method (checks memtable first, then SSTables level by level).
+// If snap is non-nil, only versions written at or before snap's sequence are
+// visible; a version written after it is skipped as if it didn't exist,
+// falling through to older, already-flushed data instead. A tombstone hit
+// that is visible means the key is deleted, so the search stops there
+// instead of falling through to older, shadowed data.
+func (lsm *LSMTree) Get(key string, snap *Snapshot) (string, bool) {
 	// Check memtable first
-	if value, found := lsm.memTable.get(key); found {
-		return value, true
-	}
-	// Check sstable files
-	files := lsm.findSSTableFiles()
-	for _, filename := range files {
-		if value, found := lsm.searchSSTableFile(filename, key); found {
-			return value, true
-		}
-	}
-	return "", false
-}
-
-// Search for a key in a specific SSTableFile
-func (lsm *LSMTree) searchSSTableFile(filename, key string) (string, bool) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return "", false // file can't be found or doesn't exist
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	lineCount := 0
-	for scanner.Scan() {
-		lineCount++
+	if e, found := lsm.memTable.get(key); found && visibleTo(e.Seq, snap) {
+		return e.Value, !e.Deleted
 	}
 
-	if lineCount == 0 {
-		return "", false
+	// Snapshot the level manifests under a read lock; compaction only takes the
+	// write lock briefly to swap these slices, so reads never block on merging.
+	lsm.levelsMu.RLock()
+	levels := make([][]int, len(lsm.levels))
+	for i, ids := range lsm.levels {
+		levels[i] = append([]int(nil), ids...)
 	}
+	sstables := lsm.sstables
+	lsm.levelsMu.RUnlock()
 
-	// Binary search on line numbers
-	left, right := 0, lineCount-1
-	for left <= right {
-		mid := (left + right) / 2
-		// Seek back to the beginning and read to line 'mid'
-		file.Seek(0, 0)
-		scanner := bufio.NewScanner(file)
-		// Skip to the mid line
-		for i := 0; i < mid; i++ {
-			scanner.Scan()
-		}
-
-		// Read the target line
-		if !scanner.Scan() {
-			break
+	// Level 0 files can overlap, so check newest-first.
+	for i := len(levels[0]) - 1; i >= 0; i-- {
+		sst := sstables[levels[0][i]]
+		if sst == nil || key < sst.minKey || key > sst.maxKey {
+			continue
 		}
-		line := scanner.Text()
-		parts := strings.SplitN(line, ",", 2)
-		if len(parts) != 2 {
-			break
+		value, found, deleted, seq, err := sst.Get(key, snap)
+		if err != nil {
+			fmt.Printf("Warning: error reading SSTable %s: %v\n", sst.filename, err)
+			continue
 		}
-		lineKey := parts[0]
-		if lineKey < key {
-			left = mid + 1
-		} else if lineKey > key {
-			right = mid - 1
-		} else {
-			// found it
-			return parts[1], true
+		if found && visibleTo(seq, snap) {
+			return value, !deleted
 		}
+	}
 
+	// Levels 1+ are non-overlapping, so at most one file per level can contain key.
+	for level := 1; level < len(levels); level++ {
+		for _, id := range levels[level] {
+			sst := sstables[id]
+			if sst == nil || key < sst.minKey || key > sst.maxKey {
+				continue
+			}
+			value, found, deleted, seq, err := sst.Get(key, snap)
+			if err != nil {
+				fmt.Printf("Warning: error reading SSTable %s: %v\n", sst.filename, err)
+			} else if found && visibleTo(seq, snap) {
+				return value, !deleted
+			}
+			break
+		}
 	}
 	return "", false
 }
 
-func (lsm *LSMTree) findSSTableFiles() []string {
-	var files []string
-	for i := 1; i < lsm.nextSSTableID; i++ {
-		filename := fmt.Sprintf("%s/%s-%04d.sst", lsm.sstablePrefix, lsm.sstablePrefix, i)
-		if _, err := os.Stat(filename); err == nil {
-			files = append(files, filename)
-		}
-	}
-	// return in reverse order, newest files first, remember?
-	for i, j := 0, len(files)-1; i < j; i, j = i+1, j-1 {
-		files[i], files[j] = files[j], files[i]
-	}
-	return files
+// visibleTo reports whether an entry written at seq is visible to snap: every
+// entry is visible when snap is nil (meaning "latest"), otherwise only
+// entries written at or before snap's sequence are.
+func visibleTo(seq uint64, snap *Snapshot) bool {
+	return snap == nil || seq <= snap.seq
 }
 
 func (lsm *LSMTree) replayWAL() {
@@ -444,18 +470,21 @@ func (lsm *LSMTree) replayWAL() {
 	}
 	defer file.Close()
 	fmt.Printf("Replaying WAL from %s...\n", lsm.walPath)
-	scanner := bufio.NewScanner(file)
-	count := 0
-	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.SplitN(line, ",", 2)
-		if len(parts) == 2 {
-			lsm.memTable.insert(parts[0], parts[1])
-			count++
+
+	records, lastWALSeq := decodeBatches(file)
+	for _, r := range records {
+		seq := lsm.nextSeq
+		lsm.nextSeq++
+		switch r.op {
+		case OpPut:
+			lsm.memTable.insert(r.key, r.value, seq)
+		case OpDelete:
+			lsm.memTable.putTombstone(r.key, seq)
 		}
 	}
-	if count > 0 {
-		fmt.Printf("Recovered %d entries from WAL\n", count)
+	lsm.nextWALSeq = lastWALSeq + 1
+	if len(records) > 0 {
+		fmt.Printf("Recovered %d record(s) from WAL\n", len(records))
 	}
 }
 
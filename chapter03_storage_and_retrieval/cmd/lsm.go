@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strconv"
 
 	"github.com/spf13/cobra"
 )
@@ -59,6 +60,165 @@ var lsmDbGetCmd = &cobra.Command{
 	},
 }
 
+var lsmCompactCmd = &cobra.Command{
+	Use:   "compact",
+	Args:  cobra.NoArgs,
+	Short: "Forces a full compaction of the LSM-Tree (LSM)",
+	Long: `Compacts every level into the level below it, from L0 down, until all
+data sits in the bottommost level, rather than waiting for the background
+compaction goroutine (which only compacts over-budget levels).`,
+	Run: func(cmd *cobra.Command, args []string) {
+		host, _ := cmd.Flags().GetString("host")
+		port, _ := cmd.Flags().GetString("port")
+		serverURL := fmt.Sprintf("http://%s:%s", host, port)
+
+		if err := makeHTTPCompactRequest(serverURL); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return
+		}
+		fmt.Println("Compaction complete")
+	},
+}
+
+var lsmStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Args:  cobra.NoArgs,
+	Short: "Prints per-level file counts and byte sizes (LSM)",
+	Run: func(cmd *cobra.Command, args []string) {
+		host, _ := cmd.Flags().GetString("host")
+		port, _ := cmd.Flags().GetString("port")
+		serverURL := fmt.Sprintf("http://%s:%s", host, port)
+
+		stats, err := makeHTTPStatsRequest(serverURL)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return
+		}
+		for _, s := range stats {
+			fmt.Printf("L%d: %d file(s), %d bytes\n", s.Level, s.FileCount, s.Bytes)
+		}
+	},
+}
+
+var lsmDeleteCmd = &cobra.Command{
+	Use:   "delete [key]",
+	Args:  cobra.ExactArgs(1),
+	Short: "Deletes a key from the database (LSM)",
+	Long: `Writes a tombstone for the key in the database file,
+using SSTables and LSMTrees.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		host, _ := cmd.Flags().GetString("host")
+		port, _ := cmd.Flags().GetString("port")
+		serverURL := fmt.Sprintf("http://%s:%s", host, port)
+
+		err := makeHTTPDeleteRequest(serverURL, args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return
+		}
+		fmt.Printf("Deleted %s\n", args[0])
+	},
+}
+
+var lsmBatchCmd = &cobra.Command{
+	Use:   "batch",
+	Args:  cobra.NoArgs,
+	Short: "Applies a batch of ops read from stdin atomically (LSM)",
+	Long: `Reads newline-delimited ops from stdin, one per line:
+  PUT key value
+  DELETE key
+and applies them to the server as a single atomic WriteBatch.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		host, _ := cmd.Flags().GetString("host")
+		port, _ := cmd.Flags().GetString("port")
+		serverURL := fmt.Sprintf("http://%s:%s", host, port)
+
+		ops, err := parseBatchStdin(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return
+		}
+		if err := makeHTTPBatchRequest(serverURL, ops); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return
+		}
+		fmt.Printf("Applied batch of %d op(s)\n", len(ops))
+	},
+}
+
+var lsmScanCmd = &cobra.Command{
+	Use:   "scan",
+	Args:  cobra.NoArgs,
+	Short: "Lists key/value pairs in a key range (LSM)",
+	Long: `Lists every key in [--start, --end) in sorted order, merging the
+memtable with every overlapping SSTable. An empty --start/--end is
+unbounded on that side. Pass --snapshot to read a previously pinned
+point-in-time view instead of the latest data.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		host, _ := cmd.Flags().GetString("host")
+		port, _ := cmd.Flags().GetString("port")
+		serverURL := fmt.Sprintf("http://%s:%s", host, port)
+
+		start, _ := cmd.Flags().GetString("start")
+		end, _ := cmd.Flags().GetString("end")
+		limit, _ := cmd.Flags().GetInt("limit")
+		snapshotID, _ := cmd.Flags().GetUint64("snapshot")
+
+		rows, err := makeHTTPScanRequest(serverURL, start, end, limit, snapshotID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return
+		}
+		for _, row := range rows {
+			fmt.Printf("%s=%s\n", row.Key, row.Value)
+		}
+	},
+}
+
+var lsmSnapshotCreateCmd = &cobra.Command{
+	Use:   "snapshot-create",
+	Args:  cobra.NoArgs,
+	Short: "Pins a point-in-time snapshot for repeated reads (LSM)",
+	Long: `Pins the current write sequence server-side so later 'get'/'scan'
+calls against --snapshot see a consistent view, and compaction keeps
+whatever versions that view still needs. Release it with
+'snapshot-release' once done, or its pinned versions are retained forever.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		host, _ := cmd.Flags().GetString("host")
+		port, _ := cmd.Flags().GetString("port")
+		serverURL := fmt.Sprintf("http://%s:%s", host, port)
+
+		id, err := makeHTTPCreateSnapshotRequest(serverURL)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return
+		}
+		fmt.Printf("Created snapshot %d\n", id)
+	},
+}
+
+var lsmSnapshotReleaseCmd = &cobra.Command{
+	Use:   "snapshot-release [id]",
+	Args:  cobra.ExactArgs(1),
+	Short: "Releases a previously pinned snapshot (LSM)",
+	Run: func(cmd *cobra.Command, args []string) {
+		host, _ := cmd.Flags().GetString("host")
+		port, _ := cmd.Flags().GetString("port")
+		serverURL := fmt.Sprintf("http://%s:%s", host, port)
+
+		id, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid snapshot id %q\n", args[0])
+			return
+		}
+		if err := makeHTTPReleaseSnapshotRequest(serverURL, id); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return
+		}
+		fmt.Printf("Released snapshot %d\n", id)
+	},
+}
+
 var lsmServeCmd = &cobra.Command{
 	Use:   "serve",
 	Short: "Start the LSM-Tree HTTP Server",
@@ -67,19 +227,41 @@ var lsmServeCmd = &cobra.Command{
 		port, _ := cmd.Flags().GetString("port")
 		sstablePrefix, _ := cmd.Flags().GetString("sstable-prefix")
 		maxMemTableSize, _ := cmd.Flags().GetInt("max-memtable-size")
+		compressionName, _ := cmd.Flags().GetString("compression")
+		blockCacheMiB, _ := cmd.Flags().GetInt("block-cache-mb")
+
+		compression, err := parseCompression(compressionName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return
+		}
+
 		fmt.Printf("Starting LSMTree server on port %s...\n", port)
-		startLSMServer(port, sstablePrefix, maxMemTableSize)
+		startLSMServer(port, sstablePrefix, maxMemTableSize, compression, blockCacheMiB)
 	},
 }
 
 func init() {
 	lsmCmd.AddCommand(lsmDbSetCmd)
 	lsmCmd.AddCommand(lsmDbGetCmd)
+	lsmCmd.AddCommand(lsmDeleteCmd)
+	lsmCmd.AddCommand(lsmCompactCmd)
+	lsmCmd.AddCommand(lsmStatsCmd)
+	lsmCmd.AddCommand(lsmBatchCmd)
+	lsmCmd.AddCommand(lsmScanCmd)
+	lsmCmd.AddCommand(lsmSnapshotCreateCmd)
+	lsmCmd.AddCommand(lsmSnapshotReleaseCmd)
 	lsmCmd.AddCommand(lsmServeCmd)
 	rootCmd.AddCommand(lsmCmd)
 	lsmServeCmd.PersistentFlags().StringP("sstable-prefix", "P", "sstable", "Path to the SST+LSMT Database log directory")
 	lsmServeCmd.PersistentFlags().IntP("max-memtable-size", "m", 1000, "Maximum entries in the memtable before flush.")
+	lsmServeCmd.PersistentFlags().String("compression", "none", "Data block compression codec for new SSTables: \"none\" or \"snappy\"")
+	lsmServeCmd.PersistentFlags().Int("block-cache-mb", 32, "Size of the decoded data block cache, in MiB (0 disables it)")
 	// client flags (for set/get commands)
 	lsmCmd.PersistentFlags().StringP("host", "H", "localhost", "LSM server host")
 	lsmCmd.PersistentFlags().StringP("port", "p", "8080", "LSM server port")
+	lsmScanCmd.Flags().String("start", "", "Inclusive start of the key range (unbounded if omitted)")
+	lsmScanCmd.Flags().String("end", "", "Exclusive end of the key range (unbounded if omitted)")
+	lsmScanCmd.Flags().Int("limit", 0, "Maximum number of rows to return (0 for unlimited)")
+	lsmScanCmd.Flags().Uint64("snapshot", 0, "Snapshot id to read from (0 for the latest data)")
 }
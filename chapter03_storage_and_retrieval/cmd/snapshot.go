@@ -0,0 +1,67 @@
+package cmd
+
+import "sort"
+
+// Snapshot pins a write sequence number so that Get and Iterator can
+// reconstruct a consistent point-in-time view: any entry written after the
+// snapshot was taken (Seq greater than the pinned sequence) is invisible to
+// it. Snapshots are created with LSMTree.Snapshot and must be released with
+// LSMTree.ReleaseSnapshot once the caller is done with them, so compaction
+// knows when it is safe to reclaim the versions they were pinning.
+type Snapshot struct {
+	id  uint64
+	seq uint64
+}
+
+func (s *Snapshot) ID() uint64 {
+	return s.id
+}
+
+// Snapshot captures the current write sequence and pins it so that
+// compaction will retain whatever version of a key was newest as of this
+// call, even if that key is overwritten or deleted afterwards. Callers must
+// hold whatever lock already serializes access to the tree, the same as
+// every other LSMTree method.
+func (lsm *LSMTree) Snapshot() *Snapshot {
+	lsm.snapshotsMu.Lock()
+	defer lsm.snapshotsMu.Unlock()
+
+	id := lsm.nextSnapshotID
+	lsm.nextSnapshotID++
+	snap := &Snapshot{id: id, seq: lsm.nextSeq - 1}
+	lsm.snapshots[id] = snap
+	return snap
+}
+
+// ReleaseSnapshot unpins a snapshot, allowing compaction to drop any older
+// versions it was the last reader of. Releasing an unknown id is a no-op.
+func (lsm *LSMTree) ReleaseSnapshot(id uint64) {
+	lsm.snapshotsMu.Lock()
+	defer lsm.snapshotsMu.Unlock()
+	delete(lsm.snapshots, id)
+}
+
+func (lsm *LSMTree) lookupSnapshot(id uint64) *Snapshot {
+	lsm.snapshotsMu.Lock()
+	defer lsm.snapshotsMu.Unlock()
+	return lsm.snapshots[id]
+}
+
+// liveSnapshotSeqs returns the distinct sequence numbers of every currently
+// live snapshot, ascending, so compaction can retain a version for each one
+// rather than just the single oldest.
+func (lsm *LSMTree) liveSnapshotSeqs() []uint64 {
+	lsm.snapshotsMu.Lock()
+	defer lsm.snapshotsMu.Unlock()
+
+	seen := make(map[uint64]bool, len(lsm.snapshots))
+	seqs := make([]uint64, 0, len(lsm.snapshots))
+	for _, snap := range lsm.snapshots {
+		if !seen[snap.seq] {
+			seen[snap.seq] = true
+			seqs = append(seqs, snap.seq)
+		}
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs
+}
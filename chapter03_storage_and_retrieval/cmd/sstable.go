@@ -0,0 +1,490 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"sort"
+)
+
+const (
+	sstableBlockSize = 4 * 1024 // target size of a data block, in bytes
+	bloomBitsPerKey  = 10       // configurable bits-per-key for the bloom filter
+	bloomHashCount   = 7        // ~= bitsPerKey * ln(2), the standard false-positive-minimizing choice
+	sstableFooterLen = 33       // 4 uint64s (index/bloom offset+length) + 1 compression tag byte
+)
+
+// blockHandle points at one data block inside an SSTable file.
+type blockHandle struct {
+	firstKey string
+	offset   int64
+	length   int64
+}
+
+// entryTypeTag encodes Entry.Deleted as the one-byte type tag carried by
+// every Put/Delete record on disk; parseBlockEntries decodes it back.
+const (
+	entryTypePut    = 0
+	entryTypeDelete = 1
+)
+
+func entryTypeTag(e Entry) int {
+	if e.Deleted {
+		return entryTypeDelete
+	}
+	return entryTypePut
+}
+
+// BloomFilter is a simple bits-per-key bloom filter. It uses double hashing
+// (an FNV-1a hash and an FNV-1 hash combined as h1 + i*h2) to simulate
+// bloomHashCount independent hash functions without computing that many.
+type BloomFilter struct {
+	bits      []byte
+	numBits   int
+	numHashes int
+}
+
+func newBloomFilter(numKeys, bitsPerKey int) *BloomFilter {
+	numBits := numKeys * bitsPerKey
+	if numBits < 64 {
+		numBits = 64
+	}
+	return &BloomFilter{
+		bits:      make([]byte, (numBits+7)/8),
+		numBits:   numBits,
+		numHashes: bloomHashCount,
+	}
+}
+
+func bloomHashes(key string) (uint32, uint32) {
+	h1 := fnv.New32a()
+	h1.Write([]byte(key))
+	h2 := fnv.New32()
+	h2.Write([]byte(key))
+	return h1.Sum32(), h2.Sum32()
+}
+
+func (f *BloomFilter) Add(key string) {
+	h1, h2 := bloomHashes(key)
+	for i := 0; i < f.numHashes; i++ {
+		bit := (uint64(h1) + uint64(i)*uint64(h2)) % uint64(f.numBits)
+		f.bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// MightContain returns false only when key is definitely absent.
+func (f *BloomFilter) MightContain(key string) bool {
+	h1, h2 := bloomHashes(key)
+	for i := 0; i < f.numHashes; i++ {
+		bit := (uint64(h1) + uint64(i)*uint64(h2)) % uint64(f.numBits)
+		if f.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *BloomFilter) encode() []byte {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header[0:4], uint32(f.numBits))
+	binary.BigEndian.PutUint32(header[4:8], uint32(f.numHashes))
+	return append(header, f.bits...)
+}
+
+func decodeBloomFilter(data []byte) (*BloomFilter, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("bloom filter data too short")
+	}
+	return &BloomFilter{
+		numBits:   int(binary.BigEndian.Uint32(data[0:4])),
+		numHashes: int(binary.BigEndian.Uint32(data[4:8])),
+		bits:      data[8:],
+	}, nil
+}
+
+// SSTableReader owns an SSTable's in-memory block index and bloom filter, so
+// a lookup costs one index binary search plus one block read instead of
+// scanning the file.
+type SSTableReader struct {
+	id          int
+	filename    string
+	level       int
+	minKey      string
+	maxKey      string
+	size        int64
+	index       []blockHandle
+	filter      *BloomFilter
+	compression byte // nominal codec recorded in the footer; blocks self-describe via their own trailer
+	cache       *blockCache
+}
+
+// writeSSTable writes sorted entries to filename as fixed-size data blocks
+// (each optionally Snappy-compressed, per compression) followed by an index
+// block (first key of each data block -> file offset) and a footer pointing
+// at the index and bloom filter, then opens and returns a reader over the
+// file it just wrote.
+func writeSSTable(id, level int, filename string, entries []Entry, compression byte, cache *blockCache) (*SSTableReader, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSTable: %w", err)
+	}
+	defer file.Close()
+
+	filter := newBloomFilter(len(entries), bloomBitsPerKey)
+
+	var (
+		index      []blockHandle
+		block      bytes.Buffer
+		blockStart int64
+		firstKey   string
+		offset     int64
+	)
+	flushBlock := func() error {
+		if block.Len() == 0 {
+			return nil
+		}
+		encoded := encodeBlock(block.Bytes(), compression)
+		n, err := file.Write(encoded)
+		if err != nil {
+			return fmt.Errorf("failed to write data block: %w", err)
+		}
+		index = append(index, blockHandle{firstKey: firstKey, offset: blockStart, length: int64(n)})
+		offset += int64(n)
+		blockStart = offset
+		block.Reset()
+		return nil
+	}
+
+	for i, e := range entries {
+		filter.Add(e.Key)
+		if block.Len() == 0 {
+			firstKey = e.Key
+		}
+		block.Write(encodeEntry(e))
+		// Never split a run of same-key versions across a block boundary:
+		// Get only scans for a visible version within the one block its
+		// index search lands on.
+		sameKeyFollows := i+1 < len(entries) && entries[i+1].Key == e.Key
+		if block.Len() >= sstableBlockSize && !sameKeyFollows {
+			if err := flushBlock(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := flushBlock(); err != nil {
+		return nil, err
+	}
+
+	indexOffset := offset
+	var indexBlock bytes.Buffer
+	for _, h := range index {
+		indexBlock.Write(encodeIndexEntry(h))
+	}
+	indexBytes := indexBlock.Bytes()
+	if _, err := file.Write(indexBytes); err != nil {
+		return nil, fmt.Errorf("failed to write index block: %w", err)
+	}
+
+	bloomOffset := indexOffset + int64(len(indexBytes))
+	bloomBytes := filter.encode()
+	if _, err := file.Write(bloomBytes); err != nil {
+		return nil, fmt.Errorf("failed to write bloom filter: %w", err)
+	}
+
+	footer := make([]byte, sstableFooterLen)
+	binary.BigEndian.PutUint64(footer[0:8], uint64(indexOffset))
+	binary.BigEndian.PutUint64(footer[8:16], uint64(len(indexBytes)))
+	binary.BigEndian.PutUint64(footer[16:24], uint64(bloomOffset))
+	binary.BigEndian.PutUint64(footer[24:32], uint64(len(bloomBytes)))
+	footer[32] = compression
+	if _, err := file.Write(footer); err != nil {
+		return nil, fmt.Errorf("failed to write footer: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat SSTable: %w", err)
+	}
+
+	return &SSTableReader{
+		id:          id,
+		filename:    filename,
+		level:       level,
+		minKey:      entries[0].Key,
+		maxKey:      entries[len(entries)-1].Key,
+		size:        info.Size(),
+		index:       index,
+		filter:      filter,
+		compression: compression,
+		cache:       cache,
+	}, nil
+}
+
+// openSSTableReader loads the footer, index block and bloom filter of an
+// existing SSTable file, e.g. when recovering a tree that was already on
+// disk. id and level are metadata the caller already knows from the
+// filename/manifest, not stored in the file itself.
+func openSSTableReader(id, level int, filename string, cache *blockCache) (*SSTableReader, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SSTable %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat SSTable %s: %w", filename, err)
+	}
+	if info.Size() < sstableFooterLen {
+		return nil, fmt.Errorf("SSTable %s is too small to contain a footer", filename)
+	}
+
+	footer := make([]byte, sstableFooterLen)
+	if _, err := file.ReadAt(footer, info.Size()-sstableFooterLen); err != nil {
+		return nil, fmt.Errorf("failed to read footer of %s: %w", filename, err)
+	}
+	indexOffset := int64(binary.BigEndian.Uint64(footer[0:8]))
+	indexLength := int64(binary.BigEndian.Uint64(footer[8:16]))
+	bloomOffset := int64(binary.BigEndian.Uint64(footer[16:24]))
+	bloomLength := int64(binary.BigEndian.Uint64(footer[24:32]))
+	compression := footer[32]
+
+	indexBytes := make([]byte, indexLength)
+	if _, err := file.ReadAt(indexBytes, indexOffset); err != nil {
+		return nil, fmt.Errorf("failed to read index block of %s: %w", filename, err)
+	}
+	index, err := parseIndexBlock(indexBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse index block of %s: %w", filename, err)
+	}
+
+	bloomBytes := make([]byte, bloomLength)
+	if _, err := file.ReadAt(bloomBytes, bloomOffset); err != nil {
+		return nil, fmt.Errorf("failed to read bloom filter of %s: %w", filename, err)
+	}
+	filter, err := decodeBloomFilter(bloomBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode bloom filter of %s: %w", filename, err)
+	}
+
+	reader := &SSTableReader{
+		id:          id,
+		filename:    filename,
+		level:       level,
+		size:        info.Size(),
+		index:       index,
+		filter:      filter,
+		compression: compression,
+		cache:       cache,
+	}
+	if len(index) > 0 {
+		reader.minKey = index[0].firstKey
+		lastBlock, err := readBlock(filename, id, index[len(index)-1], cache)
+		if err != nil {
+			return nil, err
+		}
+		if len(lastBlock) > 0 {
+			reader.maxKey = lastBlock[len(lastBlock)-1].Key
+		}
+	}
+	return reader, nil
+}
+
+// encodeIndexEntry serializes a blockHandle as a length-prefixed firstKey
+// followed by fixed-width big-endian offset/length, mirroring the WAL's
+// appendLengthPrefixed scheme (chunk0-3) instead of delimiter-based text, so
+// a firstKey containing a comma or newline can't corrupt the index.
+func encodeIndexEntry(h blockHandle) []byte {
+	buf := appendLengthPrefixed(nil, h.firstKey)
+	offsetAndLength := make([]byte, 16)
+	binary.BigEndian.PutUint64(offsetAndLength[0:8], uint64(h.offset))
+	binary.BigEndian.PutUint64(offsetAndLength[8:16], uint64(h.length))
+	return append(buf, offsetAndLength...)
+}
+
+func parseIndexBlock(data []byte) ([]blockHandle, error) {
+	var index []blockHandle
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		firstKey, err := readLengthPrefixed(r)
+		if err != nil {
+			return nil, fmt.Errorf("malformed index entry: %w", err)
+		}
+		offsetAndLength := make([]byte, 16)
+		if _, err := io.ReadFull(r, offsetAndLength); err != nil {
+			return nil, fmt.Errorf("malformed index entry: %w", err)
+		}
+		index = append(index, blockHandle{
+			firstKey: firstKey,
+			offset:   int64(binary.BigEndian.Uint64(offsetAndLength[0:8])),
+			length:   int64(binary.BigEndian.Uint64(offsetAndLength[8:16])),
+		})
+	}
+	return index, nil
+}
+
+// readBlock reads and parses one data block, consulting cache first so a hot
+// block is read and decompressed from disk at most once. Each cache-miss
+// call opens the file itself rather than keeping a handle around, same as
+// the rest of this package's file-per-operation style.
+func readBlock(filename string, sstableID int, h blockHandle, cache *blockCache) ([]Entry, error) {
+	key := blockCacheKey{sstableID: sstableID, offset: h.offset}
+	if data, ok := cache.get(key); ok {
+		return parseBlockEntries(data)
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SSTable %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	raw := make([]byte, h.length)
+	if _, err := file.ReadAt(raw, h.offset); err != nil {
+		return nil, fmt.Errorf("failed to read block of %s: %w", filename, err)
+	}
+
+	data, pooled, err := decodeBlock(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode block of %s: %w", filename, err)
+	}
+
+	entries, parseErr := parseBlockEntries(data)
+	if retained := cache.put(key, data); !retained && pooled {
+		releaseBlockBuffer(data)
+	}
+	return entries, parseErr
+}
+
+// encodeEntry serializes one Entry as [type tag byte][seq uint64][keyLen
+// uint32][key][valLen uint32][value], mirroring the WAL batch record format
+// (chunk0-3) instead of delimiter-based text, so a key or value containing a
+// comma or newline can't corrupt the block or be silently truncated. The
+// block's own trailer CRC32C (chunk0-6) already covers the whole payload, so
+// entries don't need a per-record checksum of their own.
+func encodeEntry(e Entry) []byte {
+	buf := make([]byte, 0, 1+8+4+len(e.Key)+4+len(e.Value))
+	buf = append(buf, byte(entryTypeTag(e)))
+	seqBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(seqBytes, e.Seq)
+	buf = append(buf, seqBytes...)
+	buf = appendLengthPrefixed(buf, e.Key)
+	buf = appendLengthPrefixed(buf, e.Value)
+	return buf
+}
+
+func parseBlockEntries(data []byte) ([]Entry, error) {
+	var entries []Entry
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		tagByte := make([]byte, 1)
+		if _, err := io.ReadFull(r, tagByte); err != nil {
+			return nil, fmt.Errorf("malformed block entry: %w", err)
+		}
+		seqBytes := make([]byte, 8)
+		if _, err := io.ReadFull(r, seqBytes); err != nil {
+			return nil, fmt.Errorf("malformed block entry: %w", err)
+		}
+		key, err := readLengthPrefixed(r)
+		if err != nil {
+			return nil, fmt.Errorf("malformed block entry: %w", err)
+		}
+		value, err := readLengthPrefixed(r)
+		if err != nil {
+			return nil, fmt.Errorf("malformed block entry: %w", err)
+		}
+		entries = append(entries, Entry{
+			Key:     key,
+			Value:   value,
+			Deleted: tagByte[0] == entryTypeDelete,
+			Seq:     binary.BigEndian.Uint64(seqBytes),
+		})
+	}
+	return entries, nil
+}
+
+// Get consults the bloom filter before touching disk at all, then does one
+// index binary search and one block read on a possible hit. deleted reports
+// whether the matching entry is a tombstone; callers must treat that as "not
+// found here" without falling through to older data. If snap is non-nil and
+// compaction retained more than one version of key (see mergeSSTables: up to
+// one extra per distinct live snapshot), Get scans forward through that
+// newest-first run for the newest version
+// at or before snap's sequence instead of always returning the very latest.
+func (r *SSTableReader) Get(key string, snap *Snapshot) (value string, found bool, deleted bool, seq uint64, err error) {
+	if r.filter != nil && !r.filter.MightContain(key) {
+		return "", false, false, 0, nil
+	}
+	if len(r.index) == 0 || key < r.index[0].firstKey {
+		return "", false, false, 0, nil
+	}
+
+	// The last block whose firstKey <= key is the only one that can hold it.
+	i := sort.Search(len(r.index), func(i int) bool { return r.index[i].firstKey > key })
+	blockIdx := i - 1
+	if blockIdx < 0 {
+		return "", false, false, 0, nil
+	}
+
+	entries, err := readBlock(r.filename, r.id, r.index[blockIdx], r.cache)
+	if err != nil {
+		return "", false, false, 0, err
+	}
+	j := sort.Search(len(entries), func(i int) bool { return entries[i].Key >= key })
+	for ; j < len(entries) && entries[j].Key == key; j++ {
+		e := entries[j]
+		if snap == nil || e.Seq <= snap.seq {
+			return e.Value, true, e.Deleted, e.Seq, nil
+		}
+	}
+	return "", false, false, 0, nil
+}
+
+// ReadAll reads every entry back into memory in key order. Used by
+// compaction, which merges whole files rather than looking up one key.
+func (r *SSTableReader) ReadAll() ([]Entry, error) {
+	var all []Entry
+	for _, h := range r.index {
+		entries, err := readBlock(r.filename, r.id, h, r.cache)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, entries...)
+	}
+	return all, nil
+}
+
+// ReadRange reads only the data blocks that can hold a key in [start, end),
+// the same index binary search Get uses rather than reading the whole file,
+// so a scan over a narrow range touches a narrow slice of the file. An empty
+// start/end is unbounded on that side. The first and last block read may
+// contain entries outside the range; callers filter those out.
+func (r *SSTableReader) ReadRange(start, end string) ([]Entry, error) {
+	if len(r.index) == 0 {
+		return nil, nil
+	}
+
+	startIdx := 0
+	if start != "" {
+		i := sort.Search(len(r.index), func(i int) bool { return r.index[i].firstKey > start })
+		if i > 0 {
+			startIdx = i - 1
+		}
+	}
+
+	var out []Entry
+	for i := startIdx; i < len(r.index); i++ {
+		if end != "" && r.index[i].firstKey >= end {
+			break
+		}
+		entries, err := readBlock(r.filename, r.id, r.index[i], r.cache)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, entries...)
+	}
+	return out, nil
+}